@@ -0,0 +1,121 @@
+package s3zip
+
+import (
+	"archive/zip"
+	"io"
+	"time"
+)
+
+// Archiver writes a sequence of named files into an archive format, streamed
+// to an io.Writer. Callers must call Begin before any AddFile, and Close
+// once all files have been added.
+type Archiver interface {
+	// Begin starts writing an archive to w.
+	Begin(w io.Writer) error
+
+	// AddFile adds a single file to the archive. size must be the exact
+	// number of bytes that will be read from r: several archive formats
+	// (notably tar) require the size to be known up front.
+	AddFile(name string, modTime time.Time, size int64, r io.Reader) error
+
+	// Close finishes the archive, flushing any trailing metadata to the
+	// writer passed to Begin.
+	Close() error
+}
+
+// ZipArchiver writes a zip archive, using the given compression method for
+// every entry.
+type ZipArchiver struct {
+	method uint16
+
+	zw *zip.Writer
+	cw *countingWriter
+
+	// lastOffset/lastDataOffset/lastCompressedSize describe the entry most
+	// recently added via AddFile, in bytes written to the writer passed to
+	// Begin. Only populated when method is zip.Store (see WithManifest):
+	// archive/zip always defers a closed entry's trailing data descriptor to
+	// the next CreateHeader or Close call rather than writing it
+	// immediately, so these have to be measured here, right after
+	// CreateHeader/io.Copy, rather than predicted from outside; and only
+	// zip.Store's compressor (unlike Deflate's) writes through without
+	// buffering any of an entry's own data, so a.cw is exact once
+	// zip.Writer's own buffer is flushed right after io.Copy.
+	lastOffset         int64
+	lastDataOffset     int64
+	lastCompressedSize int64
+}
+
+// NewZipArchiver creates a ZipArchiver that compresses entries with method,
+// either zip.Store or zip.Deflate.
+func NewZipArchiver(method uint16) *ZipArchiver {
+	return &ZipArchiver{method: method}
+}
+
+func (a *ZipArchiver) Begin(w io.Writer) error {
+	a.cw = &countingWriter{w: w}
+	a.zw = zip.NewWriter(a.cw)
+	return nil
+}
+
+func (a *ZipArchiver) AddFile(name string, modTime time.Time, size int64, r io.Reader) error {
+	w, err := a.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   a.method,
+		Modified: modTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	if a.method == zip.Store {
+		// zip.Writer buffers internally (via its own bufio.Writer), so a.cw
+		// only reflects what's actually been written right after a Flush.
+		// Only pay for that here, not on every AddFile call, since it's only
+		// needed to populate lastOffset/lastDataOffset for WithManifest.
+		if err := a.zw.Flush(); err != nil {
+			return err
+		}
+		a.lastDataOffset = a.cw.n
+		a.lastOffset = a.lastDataOffset - zipLocalHeaderLen(name, modTime)
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+
+	if a.method == zip.Store {
+		if err := a.zw.Flush(); err != nil {
+			return err
+		}
+		a.lastCompressedSize = a.cw.n - a.lastDataOffset
+	}
+
+	return nil
+}
+
+func (a *ZipArchiver) Close() error {
+	return a.zw.Close()
+}
+
+// zipLocalHeaderLen returns the exact size, in bytes, of the zip local file
+// header archive/zip writes for an entry with the given name and
+// modification time, i.e. the gap between that entry's offset and its data
+// offset. archive/zip always writes a fixed 30-byte header (see
+// archive/zip's writeHeader) followed by the name and, whenever a non-zero
+// modTime is given, a 9-byte "extended timestamp" extra field — and nothing
+// else, for a local header (zip64 extras are only ever added to the central
+// directory, not here).
+func zipLocalHeaderLen(name string, modTime time.Time) int64 {
+	const (
+		fixedLen             = 30
+		extendedTimestampLen = 9
+	)
+
+	n := int64(fixedLen + len(name))
+	if !modTime.IsZero() {
+		n += extendedTimestampLen
+	}
+
+	return n
+}
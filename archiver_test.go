@@ -0,0 +1,144 @@
+package s3zip
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestZipArchiver(t *testing.T) {
+	var buf bytes.Buffer
+
+	a := NewZipArchiver(zip.Deflate)
+	if err := a.Begin(&buf); err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if err := a.AddFile("hello.txt", time.Now(), 5, strings.NewReader("hello")); err != nil {
+		t.Fatalf("AddFile: %v", err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("failed to read back zip: %v", err)
+	}
+	if len(zr.File) != 1 || zr.File[0].Name != "hello.txt" {
+		t.Fatalf("unexpected zip contents: %+v", zr.File)
+	}
+}
+
+func TestTarArchiver(t *testing.T) {
+	var buf bytes.Buffer
+
+	a := NewTarArchiver()
+	if err := a.Begin(&buf); err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if err := a.AddFile("hello.txt", time.Now(), 5, strings.NewReader("hello")); err != nil {
+		t.Fatalf("AddFile: %v", err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	tr := tar.NewReader(&buf)
+	hdr, err := tr.Next()
+	if err != nil {
+		t.Fatalf("failed to read back tar: %v", err)
+	}
+	if hdr.Name != "hello.txt" || hdr.Size != 5 {
+		t.Fatalf("unexpected tar header: %+v", hdr)
+	}
+}
+
+func TestZipZstdArchiver(t *testing.T) {
+	var buf bytes.Buffer
+
+	a := NewZipZstdArchiver()
+	if err := a.Begin(&buf); err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if err := a.AddFile("hello.txt", time.Now(), 5, strings.NewReader("hello")); err != nil {
+		t.Fatalf("AddFile: %v", err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("failed to read back zip: %v", err)
+	}
+	zr.RegisterDecompressor(zipMethodZstd, func(r io.Reader) io.ReadCloser {
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			panic(err)
+		}
+		return d.IOReadCloser()
+	})
+
+	if len(zr.File) != 1 || zr.File[0].Name != "hello.txt" {
+		t.Fatalf("unexpected zip contents: %+v", zr.File)
+	}
+
+	rc, err := zr.File[0].Open()
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer rc.Close()
+
+	content, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("failed to read file content: %v", err)
+	}
+	if string(content) != "hello" {
+		t.Fatalf("expected content %q, got %q", "hello", content)
+	}
+}
+
+func TestTarGzArchiver(t *testing.T) {
+	var buf bytes.Buffer
+
+	a := NewTarGzArchiver()
+	if err := a.Begin(&buf); err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if err := a.AddFile("hello.txt", time.Now(), 5, strings.NewReader("hello")); err != nil {
+		t.Fatalf("AddFile: %v", err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	gr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("failed to read back gzip: %v", err)
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	hdr, err := tr.Next()
+	if err != nil {
+		t.Fatalf("failed to read back tar: %v", err)
+	}
+	if hdr.Name != "hello.txt" {
+		t.Fatalf("unexpected tar header: %+v", hdr)
+	}
+
+	var content bytes.Buffer
+	if _, err := io.Copy(&content, tr); err != nil {
+		t.Fatalf("failed to read file content: %v", err)
+	}
+	if content.String() != "hello" {
+		t.Fatalf("expected content %q, got %q", "hello", content.String())
+	}
+}
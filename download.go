@@ -0,0 +1,185 @@
+package s3zip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// tempFile removes the underlying file from disk when closed, so callers can
+// treat it as a self-cleaning io.ReadCloser.
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.File.Name())
+	return err
+}
+
+// part is a single byte range of an object, as used in a Range request
+// header (bytes=start-end, both inclusive).
+type part struct {
+	start, end int64
+}
+
+// partsFor splits an object of the given size into PartSize-sized parts.
+func partsFor(size, partSize int64) []part {
+	if size <= 0 {
+		return nil
+	}
+	if partSize <= 0 || size <= partSize {
+		return []part{{0, size - 1}}
+	}
+
+	parts := make([]part, 0, size/partSize+1)
+	for start := int64(0); start < size; start += partSize {
+		end := start + partSize - 1
+		if end > size-1 {
+			end = size - 1
+		}
+		parts = append(parts, part{start, end})
+	}
+
+	return parts
+}
+
+// downloadParts fetches obj into w, split into z.partSize ranges downloaded
+// by z.downloadConcurrency workers in parallel. A part that fails with a
+// transient error is retried from scratch, with exponential backoff, up to
+// z.maxPartRetries times.
+func (z S3Zip) downloadParts(ctx context.Context, w io.WriterAt, obj Object, size int64) error {
+	parts := partsFor(size, z.partSize)
+	if len(parts) == 0 {
+		return nil
+	}
+
+	queue := make(chan part)
+	go func() {
+		defer close(queue)
+		for _, p := range parts {
+			select {
+			case queue <- p:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	concurrency := z.downloadConcurrency
+	if concurrency > len(parts) {
+		concurrency = len(parts)
+	}
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, concurrency)
+
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+
+			for p := range queue {
+				if err := z.downloadPartWithRetry(ctx, w, obj, p); err != nil {
+					errCh <- err
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errCh)
+
+	if err, ok := <-errCh; ok {
+		return err
+	}
+
+	return nil
+}
+
+func (z S3Zip) downloadPartWithRetry(ctx context.Context, w io.WriterAt, obj Object, p part) error {
+	var err error
+
+	for attempt := 0; attempt <= z.maxPartRetries; attempt++ {
+		if attempt > 0 {
+			backoff := time.Duration(1<<uint(attempt-1)) * 100 * time.Millisecond
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		// Discard any bytes written by the failed attempt and start the
+		// range over, rather than trying to resume mid-part.
+		err = z.downloadPart(ctx, w, obj, p)
+		if err == nil {
+			return nil
+		}
+
+		if !isRetryableDownloadError(err) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("exhausted retries downloading bytes %d-%d: %w", p.start, p.end, err)
+}
+
+func (z S3Zip) downloadPart(ctx context.Context, w io.WriterAt, obj Object, p part) error {
+	out, err := z.s3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(obj.Bucket),
+		Key:    aws.String(obj.Key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", p.start, p.end)),
+	})
+	if err != nil {
+		return err
+	}
+	defer out.Body.Close()
+
+	_, err = io.Copy(&offsetWriter{w: w, offset: p.start}, out.Body)
+
+	return err
+}
+
+// offsetWriter adapts an io.WriterAt to an io.Writer that writes sequentially
+// starting at offset.
+type offsetWriter struct {
+	w      io.WriterAt
+	offset int64
+}
+
+func (ow *offsetWriter) Write(p []byte) (int, error) {
+	n, err := ow.w.WriteAt(p, ow.offset)
+	ow.offset += int64(n)
+	return n, err
+}
+
+// isRetryableDownloadError reports whether err is a transient failure worth
+// retrying a part for: S3 5xx responses, request timeouts, or the connection
+// dropping mid-body.
+func isRetryableDownloadError(err error) bool {
+	var reqFailure awserr.RequestFailure
+	if errors.As(err, &reqFailure) {
+		if reqFailure.StatusCode() >= 500 || reqFailure.Code() == "RequestTimeout" {
+			return true
+		}
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
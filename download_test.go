@@ -0,0 +1,205 @@
+package s3zip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+func TestPartsFor(t *testing.T) {
+	cases := []struct {
+		size, partSize int64
+		want           []part
+	}{
+		{size: 0, partSize: 10, want: nil},
+		{size: 5, partSize: 10, want: []part{{0, 4}}},
+		{size: 10, partSize: 10, want: []part{{0, 9}}},
+		{size: 25, partSize: 10, want: []part{{0, 9}, {10, 19}, {20, 24}}},
+		{size: 25, partSize: 0, want: []part{{0, 24}}},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("size=%d,partSize=%d", c.size, c.partSize), func(t *testing.T) {
+			got := partsFor(c.size, c.partSize)
+			if len(got) != len(c.want) {
+				t.Fatalf("expected %d parts, got %d (%v)", len(c.want), len(got), got)
+			}
+			for i, p := range got {
+				if p != c.want[i] {
+					t.Errorf("part %d: expected %v, got %v", i, c.want[i], p)
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadConfigOptions(t *testing.T) {
+	z := New(session.New(),
+		WithPartSize(1024),
+		WithDownloadConcurrency(8),
+		WithMaxPartRetries(5),
+	)
+
+	if z.partSize != 1024 {
+		t.Errorf("expected part size to be %d, got %d", 1024, z.partSize)
+	}
+	if z.downloadConcurrency != 8 {
+		t.Errorf("expected download concurrency to be %d, got %d", 8, z.downloadConcurrency)
+	}
+	if z.maxPartRetries != 5 {
+		t.Errorf("expected max part retries to be %d, got %d", 5, z.maxPartRetries)
+	}
+}
+
+// memWriterAt is an in-memory io.WriterAt, for exercising downloads without
+// touching disk.
+type memWriterAt struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (w *memWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	end := off + int64(len(p))
+	if int64(len(w.buf)) < end {
+		grown := make([]byte, end)
+		copy(grown, w.buf)
+		w.buf = grown
+	}
+	copy(w.buf[off:end], p)
+
+	return len(p), nil
+}
+
+// flakyObjectServer serves content as a GetObject range response, answering
+// the first failFirstN requests with a 500 and every request after that
+// correctly. It disregards which byte range was requested for counting
+// purposes, since every test below downloads the object as a single part.
+func flakyObjectServer(t *testing.T, content []byte, failFirstN int) *httptest.Server {
+	t.Helper()
+
+	var mu sync.Mutex
+	attempts := 0
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		attempt := attempts
+		mu.Unlock()
+
+		if attempt <= failFirstN {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `<Error><Code>InternalError</Code><Message>transient</Message><RequestId>req</RequestId></Error>`)
+			return
+		}
+
+		start, end := int64(0), int64(len(content)-1)
+		fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end)
+
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(content[start : end+1])
+	}))
+}
+
+// testS3Zip builds an S3Zip whose s3 client talks to srv instead of AWS, with
+// the SDK's own built-in retries disabled so only z's retry logic is under
+// test.
+func testS3Zip(srv *httptest.Server, opts ...configOption) S3Zip {
+	sess := session.Must(session.NewSession(&aws.Config{
+		Endpoint:         aws.String(srv.URL),
+		Region:           aws.String("us-east-1"),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+		S3ForcePathStyle: aws.Bool(true),
+		DisableSSL:       aws.Bool(true),
+		MaxRetries:       aws.Int(0),
+	}))
+
+	return New(sess, opts...)
+}
+
+func TestDownloadPartWithRetry(t *testing.T) {
+	content := []byte("the quick brown fox jumps over the lazy dog")
+	obj := Object{Bucket: "bucket", Key: "key"}
+	p := part{0, int64(len(content) - 1)}
+
+	t.Run("succeeds after transient failures", func(t *testing.T) {
+		srv := flakyObjectServer(t, content, 2)
+		defer srv.Close()
+
+		z := testS3Zip(srv, WithMaxPartRetries(3))
+		w := &memWriterAt{}
+
+		if err := z.downloadPartWithRetry(context.Background(), w, obj, p); err != nil {
+			t.Fatalf("expected the part to eventually succeed, got %v", err)
+		}
+		if string(w.buf) != string(content) {
+			t.Errorf("expected %q, got %q", content, w.buf)
+		}
+	})
+
+	t.Run("gives up after MaxPartRetries", func(t *testing.T) {
+		srv := flakyObjectServer(t, content, 1000) // always fails
+		defer srv.Close()
+
+		z := testS3Zip(srv, WithMaxPartRetries(1))
+		w := &memWriterAt{}
+
+		err := z.downloadPartWithRetry(context.Background(), w, obj, p)
+		if err == nil {
+			t.Fatal("expected an error once retries are exhausted")
+		}
+	})
+}
+
+func TestDownloadPartsPropagatesExhaustedRetries(t *testing.T) {
+	content := []byte("the quick brown fox jumps over the lazy dog")
+
+	srv := flakyObjectServer(t, content, 1000) // always fails
+	defer srv.Close()
+
+	z := testS3Zip(srv, WithMaxPartRetries(1), WithDownloadConcurrency(2))
+	w := &memWriterAt{}
+
+	err := z.downloadParts(context.Background(), w, Object{Bucket: "bucket", Key: "key"}, int64(len(content)))
+	if err == nil {
+		t.Fatal("expected downloadParts to propagate the exhausted-retries error")
+	}
+}
+
+func TestIsRetryableDownloadError(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"5xx request failure", awserr.NewRequestFailure(awserr.New("InternalError", "boom", nil), 503, "req"), true},
+		{"RequestTimeout request failure", awserr.NewRequestFailure(awserr.New("RequestTimeout", "boom", nil), 400, "req"), true},
+		{"client error request failure", awserr.NewRequestFailure(awserr.New("NoSuchKey", "boom", nil), 404, "req"), false},
+		{"unexpected EOF", io.ErrUnexpectedEOF, true},
+		{"net error", &net.DNSError{IsTimeout: true}, true},
+		{"plain error", errors.New("boom"), false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := isRetryableDownloadError(c.err); got != c.want {
+				t.Errorf("expected %v, got %v", c.want, got)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"archive/zip"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -17,6 +18,7 @@ import (
 type Request struct {
 	Resources []Resource `json:"resources"`
 	Object    Object     `json:"object"`
+	Format    string     `json:"format"`
 }
 
 type Resource struct {
@@ -30,8 +32,27 @@ type Object struct {
 }
 
 type handler struct {
-	svc *s3.S3
-	z   s3zip.S3Zip
+	svc  *s3.S3
+	sess *session.Session
+}
+
+// archiverFor returns the Archiver matching a Request's format field.
+// The empty format defaults to a Deflate-compressed zip.
+func archiverFor(format string) (s3zip.Archiver, error) {
+	switch format {
+	case "", "zip":
+		return s3zip.NewZipArchiver(zip.Deflate), nil
+	case "zip-store":
+		return s3zip.NewZipArchiver(zip.Store), nil
+	case "zip-zstd":
+		return s3zip.NewZipZstdArchiver(), nil
+	case "tar":
+		return s3zip.NewTarArchiver(), nil
+	case "tar.gz":
+		return s3zip.NewTarGzArchiver(), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
 }
 
 func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -50,6 +71,14 @@ func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	archiver, err := archiverFor(req.Format)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	z := s3zip.New(h.sess, s3zip.WithConcurrency(10), s3zip.WithArchiver(archiver))
+
 	resources := make([]s3zip.Resource, len(req.Resources))
 	for i, res := range req.Resources {
 		resources[i] = s3zip.Resource{
@@ -57,7 +86,7 @@ func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			Object:   s3zip.Object(res.Object),
 		}
 	}
-	err = h.z.Do(ctx, s3zip.Object(req.Object), resources)
+	err = z.Do(ctx, s3zip.Object(req.Object), resources)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprint(w, err.Error())
@@ -77,8 +106,7 @@ func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func main() {
 	sess := session.Must(session.NewSession())
 	svc := s3.New(sess)
-	z := s3zip.New(sess, s3zip.WithConcurrency(10))
-	h := handler{svc: svc, z: z}
+	h := handler{svc: svc, sess: sess}
 
 	srv := http.Server{
 		Addr:         "localhost:8080",
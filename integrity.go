@@ -0,0 +1,18 @@
+package s3zip
+
+import "fmt"
+
+// IntegrityError is returned by Do when a downloaded object's SHA-256 digest
+// does not match its Resource.ExpectedSHA256.
+type IntegrityError struct {
+	Resource Resource
+	Got      string
+	Want     string
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf(
+		"integrity check failed for %s/%s: got sha256 %s, want %s",
+		e.Resource.Object.Bucket, e.Resource.Object.Key, e.Got, e.Want,
+	)
+}
@@ -0,0 +1,81 @@
+package s3zip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestIntegrityErrorMessage(t *testing.T) {
+	err := &IntegrityError{
+		Resource: Resource{Object: Object{Bucket: "b", Key: "k"}},
+		Got:      "got",
+		Want:     "want",
+	}
+
+	want := `integrity check failed for b/k: got sha256 got, want want`
+	if err.Error() != want {
+		t.Errorf("expected %q, got %q", want, err.Error())
+	}
+}
+
+func TestAddEntryIntegrityCheck(t *testing.T) {
+	const (
+		content = "hello"
+		sha256  = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	)
+
+	newRes := func(expected string) Resource {
+		return Resource{
+			FileName:       "hello.txt",
+			Object:         Object{Bucket: "b", Key: "hello.txt"},
+			ExpectedSHA256: expected,
+			body:           io.NopCloser(bytes.NewReader([]byte(content))),
+			modified:       time.Now(),
+			size:           int64(len(content)),
+		}
+	}
+
+	t.Run("matching digest", func(t *testing.T) {
+		var buf bytes.Buffer
+		a := NewZipArchiver(0)
+		if err := a.Begin(&buf); err != nil {
+			t.Fatalf("Begin: %v", err)
+		}
+		cw := &countingWriter{w: &buf}
+
+		if _, err := addEntry(a, cw, newRes(sha256), true); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("mismatched digest", func(t *testing.T) {
+		var buf bytes.Buffer
+		a := NewZipArchiver(0)
+		if err := a.Begin(&buf); err != nil {
+			t.Fatalf("Begin: %v", err)
+		}
+		cw := &countingWriter{w: &buf}
+
+		_, err := addEntry(a, cw, newRes("deadbeef"), true)
+		var integrityErr *IntegrityError
+		if !errors.As(err, &integrityErr) {
+			t.Fatalf("expected an *IntegrityError, got %v", err)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		var buf bytes.Buffer
+		a := NewZipArchiver(0)
+		if err := a.Begin(&buf); err != nil {
+			t.Fatalf("Begin: %v", err)
+		}
+		cw := &countingWriter{w: &buf}
+
+		if _, err := addEntry(a, cw, newRes("deadbeef"), false); err != nil {
+			t.Fatalf("expected no error when integrity checking is disabled, got %v", err)
+		}
+	})
+}
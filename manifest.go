@@ -0,0 +1,52 @@
+package s3zip
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ManifestEntry describes one file archived by Do, as recorded in the
+// sidecar manifest uploaded when WithManifest is set.
+type ManifestEntry struct {
+	FileName string `json:"file_name"`
+	Bucket   string `json:"bucket"`
+	Key      string `json:"key"`
+	Size     int64  `json:"size"`
+	CRC32    uint32 `json:"crc32"`
+
+	// Offset is the start of the entry's zip local file header.
+	Offset int64 `json:"offset"`
+
+	// DataOffset is the start of the entry's CompressedSize bytes of file
+	// data, i.e. past that header. Only set when WithManifest is paired with
+	// a ZipArchiver using zip.Store (see WithManifest); zero otherwise.
+	DataOffset int64 `json:"data_offset"`
+
+	// CompressedSize is the length, in bytes, of the entry's data starting
+	// at DataOffset. Equal to Size, since zip.Store doesn't compress. Only
+	// set under the same condition as DataOffset.
+	CompressedSize int64 `json:"compressed_size"`
+}
+
+// uploadManifest uploads entries as a JSON sidecar object to destObj.Bucket,
+// at z.manifestKey.
+func (z S3Zip) uploadManifest(ctx context.Context, destObj Object, entries []ManifestEntry) error {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	_, err = z.s3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(destObj.Bucket),
+		Key:         aws.String(z.manifestKey),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+
+	return err
+}
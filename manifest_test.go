@@ -0,0 +1,92 @@
+package s3zip
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+func TestCheckManifestCompatible(t *testing.T) {
+	cases := []struct {
+		name     string
+		archiver Archiver
+		wantErr  bool
+	}{
+		{"zip.Store", NewZipArchiver(zip.Store), false},
+		{"zip.Deflate", NewZipArchiver(zip.Deflate), true},
+		{"tar", NewTarArchiver(), true},
+		{"tar.gz", NewTarGzArchiver(), true},
+		{"zip zstd", NewZipZstdArchiver(), true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			z := New(session.New(), WithArchiver(c.archiver))
+
+			err := z.checkManifestCompatible()
+			if (err != nil) != c.wantErr {
+				t.Errorf("checkManifestCompatible() error = %v, wantErr %v", err, c.wantErr)
+			}
+		})
+	}
+}
+
+// TestManifestDataOffsetLocatesEntryData pins down the extraction recipe
+// documented on WithManifest: ranging into the archive at
+// [DataOffset, DataOffset+CompressedSize) must yield exactly the entry's raw
+// file data, with nothing else to parse.
+func TestManifestDataOffsetLocatesEntryData(t *testing.T) {
+	files := []struct {
+		name, content string
+	}{
+		{"a.txt", "hello"},
+		{"nested/b.txt", "a slightly longer second file"},
+	}
+
+	var buf bytes.Buffer
+	a := NewZipArchiver(zip.Store)
+	cw := &countingWriter{w: &buf}
+	if err := a.Begin(cw); err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+
+	var entries []ManifestEntry
+	for _, f := range files {
+		res := Resource{
+			FileName: f.name,
+			body:     io.NopCloser(strings.NewReader(f.content)),
+			size:     int64(len(f.content)),
+		}
+
+		entry, err := addEntry(a, cw, res, false)
+		if err != nil {
+			t.Fatalf("addEntry(%q): %v", f.name, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	data := buf.Bytes()
+	for i, entry := range entries {
+		want := files[i].content
+
+		if entry.CompressedSize != int64(len(want)) {
+			t.Errorf("%s: expected CompressedSize %d, got %d", files[i].name, len(want), entry.CompressedSize)
+		}
+		if entry.DataOffset <= entry.Offset {
+			t.Errorf("%s: expected DataOffset to be past the local header start", files[i].name)
+		}
+
+		got := string(data[entry.DataOffset : entry.DataOffset+entry.CompressedSize])
+		if got != want {
+			t.Errorf("%s: data at [DataOffset, DataOffset+CompressedSize) = %q, want %q", files[i].name, got, want)
+		}
+	}
+}
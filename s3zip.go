@@ -4,10 +4,15 @@ package s3zip
 import (
 	"archive/zip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	awsclient "github.com/aws/aws-sdk-go/aws/client"
@@ -16,31 +21,57 @@ import (
 )
 
 type S3Zip struct {
+	cfg         awsclient.ConfigProvider
 	concurrency int
-	uploader    *s3manager.Uploader
-	downloader  *s3manager.Downloader
+	compression uint16
+
+	partSize            int64
+	downloadConcurrency int
+	maxPartRetries      int
+
+	zip64       bool
+	manifestKey string
+
+	integrityCheck bool
+
+	archiver Archiver
+
+	uploader *s3manager.Uploader
+	s3       *s3.S3
 }
 
 type configOption func(*S3Zip)
 
 // New creates a new S3Zip instance
 func New(c awsclient.ConfigProvider, opts ...configOption) S3Zip {
-	const defaultConcurrency = 1
-
-	downloader := s3manager.NewDownloader(c, func(d *s3manager.Downloader) {
-		d.Concurrency = 1
-	})
+	const (
+		defaultConcurrency         = 1
+		defaultPartSize            = 5 * 1024 * 1024 // matches s3manager's default download part size
+		defaultDownloadConcurrency = 1
+		defaultMaxPartRetries      = 3
+	)
 
 	z := S3Zip{
-		concurrency: defaultConcurrency,
-		uploader:    s3manager.NewUploader(c),
-		downloader:  downloader,
+		cfg:                 c,
+		concurrency:         defaultConcurrency,
+		compression:         zip.Deflate,
+		partSize:            defaultPartSize,
+		downloadConcurrency: defaultDownloadConcurrency,
+		maxPartRetries:      defaultMaxPartRetries,
+		zip64:               true,
+		integrityCheck:      true,
+		uploader:            s3manager.NewUploader(c),
+		s3:                  s3.New(c),
 	}
 
 	for _, opt := range opts {
 		opt(&z)
 	}
 
+	if z.archiver == nil {
+		z.archiver = NewZipArchiver(z.compression)
+	}
+
 	return z
 }
 
@@ -50,13 +81,111 @@ func WithConcurrency(c int) configOption {
 	}
 }
 
-// Resource describes an S3 object that has to be packed into a zip archive.
+// WithCompression sets the zip compression method used for archived entries,
+// either zip.Store or zip.Deflate. Defaults to zip.Deflate. Only affects the
+// default zip archiver; has no effect if WithArchiver is also given.
+func WithCompression(method uint16) configOption {
+	return func(z *S3Zip) {
+		z.compression = method
+	}
+}
+
+// WithArchiver replaces the default zip archiver. Use NewTarArchiver,
+// NewTarGzArchiver or NewZipZstdArchiver for the other formats Do can
+// produce, or pass a custom Archiver implementation.
+func WithArchiver(a Archiver) configOption {
+	return func(z *S3Zip) {
+		z.archiver = a
+	}
+}
+
+// WithPartSize sets the size in bytes of each ranged GetObject request issued
+// while downloading an object. Defaults to 5 MiB.
+func WithPartSize(n int64) configOption {
+	return func(z *S3Zip) {
+		z.partSize = n
+	}
+}
+
+// WithDownloadConcurrency sets the number of parts downloaded in parallel per
+// object. Defaults to 1.
+func WithDownloadConcurrency(n int) configOption {
+	return func(z *S3Zip) {
+		z.downloadConcurrency = n
+	}
+}
+
+// WithMaxPartRetries sets how many times a single part is retried, with
+// exponential backoff, before Do gives up on the download. Defaults to 3.
+func WithMaxPartRetries(n int) configOption {
+	return func(z *S3Zip) {
+		z.maxPartRetries = n
+	}
+}
+
+// WithZip64 controls whether the archive is allowed to grow past the 32-bit
+// zip limits. WithZip64(false) has Do reject, up front, any Resource whose
+// size would push the archive past those limits, instead of silently
+// producing a Zip64 archive that an old unzip tool can't read.
+//
+// NOTE: this does not force Zip64 headers onto a small archive.
+// archive/zip's FileHeader.isZip64 decides purely from each entry's actual
+// size, and that decision isn't exposed as something a caller can override;
+// doing so would mean hand-writing zip64 extra fields ourselves instead of
+// going through archive/zip. So this package offers no way to force Zip64
+// headers onto entries that don't need them, for either setting.
+// Defaults to true.
+func WithZip64(enabled bool) configOption {
+	return func(z *S3Zip) {
+		z.zip64 = enabled
+	}
+}
+
+// WithIntegrityCheck controls whether Do verifies each Resource's
+// ExpectedSHA256 (when set) and tags the uploaded archive with its own
+// SHA-256, computed locally as the archive is streamed into the upload.
+// Disable it if you care more about throughput than tamper detection.
+// Defaults to true.
+func WithIntegrityCheck(enabled bool) configOption {
+	return func(z *S3Zip) {
+		z.integrityCheck = enabled
+	}
+}
+
+// WithManifest makes Do upload a JSON sidecar object to key, alongside the
+// archive, listing every archived file's name, source object, size, CRC32,
+// and enough offset information to extract it with a single ranged S3
+// GetObject without parsing the archive format's own index: Offset, the
+// start of the entry's zip local file header, and DataOffset, the start of
+// its CompressedSize bytes of file data (Range: bytes=DataOffset-(DataOffset+CompressedSize-1)).
+//
+// That second part is only computable for a ZipArchiver using zip.Store:
+// archive/zip always defers every entry's CRC32 and sizes to a trailing data
+// descriptor rather than the local header, so the only way to know an
+// entry's compressed size ahead of time, without decompressing the whole
+// archive back, is for compression to be a no-op. Do rejects WithManifest
+// combined with any other archiver, including a zip.Deflate ZipArchiver or a
+// ZipZstdArchiver. Disabled by default.
+func WithManifest(key string) configOption {
+	return func(z *S3Zip) {
+		z.manifestKey = key
+	}
+}
+
+// Resource describes an S3 object that has to be packed into the archive.
 type Resource struct {
 	Object   Object
 	FileName string // FileName is a desired path to the file in the archive.
 
-	// Path to the downloaded file on disk. Must be removed when no more needed.
-	fpath string
+	// ExpectedSHA256, if set, is checked against the downloaded object's
+	// hex-encoded SHA-256 digest; a mismatch fails Do with an IntegrityError.
+	ExpectedSHA256 string
+
+	// body is the object's content, downloaded into a temp file that is
+	// removed once body is closed.
+	body     io.ReadCloser
+	modified time.Time
+	size     int64
 }
 
 // Object describes an S3 object.
@@ -65,41 +194,137 @@ type Object struct {
 	Key    string
 }
 
-// Do downloads S3 objects, puts them into a zip archive
-// and uploads it to the destination S3 object.
+// Do downloads S3 objects, puts them into an archive (zip by default, see
+// WithArchiver) and uploads it to the destination S3 object.
+//
+// Each object is downloaded to a short-lived temp file (so its parts can be
+// fetched in parallel and retried independently) and then streamed into the
+// archive; the archive itself is streamed directly into the upload, so the
+// full archive is never staged on local disk.
 func (z S3Zip) Do(ctx context.Context, destObj Object, resources []Resource) error {
+	if z.manifestKey != "" {
+		if err := z.checkManifestCompatible(); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+
+	uploadDone := make(chan error, 1)
+	go func() {
+		uploadDone <- z.upload(ctx, destObj, pr)
+	}()
+
+	// archiveSHA256, when integrity checking is on, is fed every byte written
+	// to cw, i.e. the exact bytes streamed into the upload; it's read once the
+	// upload has finished successfully.
+	archiveSHA256 := sha256.New()
+	w := io.Writer(pw)
+	if z.integrityCheck {
+		w = io.MultiWriter(pw, archiveSHA256)
+	}
+
+	cw := &countingWriter{w: w}
+	if err := z.archiver.Begin(cw); err != nil {
+		pw.CloseWithError(err)
+		<-uploadDone
+		return fmt.Errorf("failed to start archive: %w", err)
+	}
+
+	guard := newSizeGuard(z.zip64 || !z.archiverIsZip())
+
 	// Start workers
 	workerQueue := gen(resources...)
 	workerChannels := make([]<-chan Resource, z.concurrency)
+	derr := &firstError{}
 	for i := 0; i < z.concurrency; i++ {
-		workerChannels[i] = z.runDownloadWorker(ctx, workerQueue)
+		workerChannels[i] = z.runDownloadWorker(ctx, workerQueue, guard, derr, cancel)
 	}
 
-	// Zip downloaded files
-	zipFpath, err := archive(merge(workerChannels...))
+	// Stream downloaded files into the archive
+	merged := merge(workerChannels...)
+	entries, err := archive(z.archiver, cw, merged, z.integrityCheck)
+	if err == nil {
+		err = derr.get()
+	}
 	if err != nil {
-		return fmt.Errorf("failed to zip: %w", err)
+		// archive stopped reading merged before it was drained (e.g. an
+		// IntegrityError on one file), so any download worker already
+		// blocked trying to hand off a finished Resource — via merge's
+		// per-worker forwarding goroutines — would otherwise never be read
+		// again and leak forever, along with the temp file it's holding.
+		// cancel stops workers still downloading; draining unblocks the
+		// ones already past that point.
+		cancel()
+		go drainResources(merged)
+
+		pw.CloseWithError(err)
+		<-uploadDone
+		return fmt.Errorf("failed to archive: %w", err)
 	}
-	defer os.Remove(zipFpath)
 
-	// Upload zip to S3
-	err = z.upload(ctx, destObj, zipFpath)
-	if err != nil {
-		return fmt.Errorf("failed to upload zip: %w", err)
+	if err := z.archiver.Close(); err != nil {
+		pw.CloseWithError(err)
+		<-uploadDone
+		return fmt.Errorf("failed to close archive: %w", err)
+	}
+
+	pw.Close()
+
+	if err := <-uploadDone; err != nil {
+		return fmt.Errorf("failed to upload archive: %w", err)
+	}
+
+	if z.integrityCheck {
+		checksum := hex.EncodeToString(archiveSHA256.Sum(nil))
+		if err := z.tagChecksum(ctx, destObj, checksum); err != nil {
+			return fmt.Errorf("failed to tag archive with its checksum: %w", err)
+		}
+	}
+
+	if z.manifestKey != "" {
+		if err := z.uploadManifest(ctx, destObj, entries); err != nil {
+			return fmt.Errorf("failed to upload manifest: %w", err)
+		}
 	}
 
 	return nil
 }
 
-func (z S3Zip) runDownloadWorker(ctx context.Context, queue <-chan Resource) <-chan Resource {
+// archiveChecksumMetadataKey is the destination object metadata key Do uses
+// to record the archive's own SHA-256, computed locally over the exact bytes
+// streamed into the upload (s3manager.Uploader has no way to surface a
+// checksum of a streamed body back to the caller).
+const archiveChecksumMetadataKey = "Sha256"
+
+// tagChecksum records checksum as metadata on the just-uploaded archive, via
+// a self-copy with a replaced metadata set.
+func (z S3Zip) tagChecksum(ctx context.Context, destObj Object, checksum string) error {
+	_, err := z.s3.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:            aws.String(destObj.Bucket),
+		Key:               aws.String(destObj.Key),
+		CopySource:        aws.String(copySource(destObj.Bucket, destObj.Key)),
+		Metadata:          map[string]*string{archiveChecksumMetadataKey: aws.String(checksum)},
+		MetadataDirective: aws.String(s3.MetadataDirectiveReplace),
+	})
+
+	return err
+}
+
+func (z S3Zip) runDownloadWorker(ctx context.Context, queue <-chan Resource, guard *sizeGuard, derr *firstError, cancel context.CancelFunc) <-chan Resource {
 	out := make(chan Resource)
 
 	go func() {
 		defer close(out)
 
 		for res := range queue {
-			res, err := z.downloadOnDisk(ctx, res)
+			res, err := z.downloadObject(ctx, res, guard)
 			if err != nil {
+				derr.set(err)
+				cancel()
 				return
 			}
 
@@ -110,99 +335,208 @@ func (z S3Zip) runDownloadWorker(ctx context.Context, queue <-chan Resource) <-c
 	return out
 }
 
-func (z S3Zip) downloadOnDisk(ctx context.Context, res Resource) (Resource, error) {
-	// Create file to download into
-	f, err := os.CreateTemp("", "*."+res.FileName)
+// downloadObject downloads res.Object in parallel, PartSize-sized ranges into
+// a temp file, retrying each part on transient failure. The caller is
+// responsible for closing res.body once it has been consumed; closing it also
+// removes the temp file.
+func (z S3Zip) downloadObject(ctx context.Context, res Resource, guard *sizeGuard) (Resource, error) {
+	head, err := z.s3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(res.Object.Bucket),
+		Key:    aws.String(res.Object.Key),
+	})
 	if err != nil {
+		return res, fmt.Errorf("failed to stat object: %w", err)
+	}
+
+	size := aws.Int64Value(head.ContentLength)
+	if err := guard.add(size); err != nil {
 		return res, err
 	}
-	defer f.Close()
+	res.size = size
+
+	if head.LastModified != nil {
+		res.modified = *head.LastModified
+	}
 
-	err = z.download(ctx, f, res.Object)
+	f, err := os.CreateTemp("", "*.s3zip.part")
 	if err != nil {
-		return res, fmt.Errorf("failed to download: %w", err)
+		return res, fmt.Errorf("failed to create a temp file: %w", err)
 	}
 
-	res.fpath = f.Name()
+	if err := z.downloadParts(ctx, f, res.Object, size); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return res, fmt.Errorf("failed to download: %w", err)
+	}
 
-	return res, nil
-}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return res, fmt.Errorf("failed to rewind downloaded file: %w", err)
+	}
 
-func (z S3Zip) download(ctx context.Context, w io.WriterAt, obj Object) error {
-	_, err := z.downloader.DownloadWithContext(ctx, w, &s3.GetObjectInput{
-		Bucket: aws.String(obj.Bucket),
-		Key:    aws.String(obj.Key),
-	})
+	res.body = &tempFile{File: f}
 
-	return err
+	return res, nil
 }
 
-func (z S3Zip) upload(ctx context.Context, destObj Object, fpath string) error {
-	zf, err := os.Open(fpath)
-	if err != nil {
-		return fmt.Errorf("failed to open a file: %w", err)
-	}
-	defer zf.Close()
-
+func (z S3Zip) upload(ctx context.Context, destObj Object, r io.Reader) error {
 	zipInput := s3manager.UploadInput{
 		Bucket: aws.String(destObj.Bucket),
 		Key:    aws.String(destObj.Key),
-		Body:   zf,
+		Body:   r,
 	}
-	_, err = z.uploader.UploadWithContext(ctx, &zipInput)
+	_, err := z.uploader.UploadWithContext(ctx, &zipInput)
 
 	return err
 }
 
-// archive returns a path to zip file with items from the queue.
-func archive(queue <-chan Resource) (string, error) {
-	zf, err := os.CreateTemp("", "*.s3.zip")
-	if err != nil {
-		return "", fmt.Errorf("failed to create a temp zip file: %w", err)
-	}
-	defer zf.Close()
+// archive writes every resource from the queue into a using cw to track each
+// entry's offset, and returns a manifest entry per file in the order it was
+// written.
+func archive(a Archiver, cw *countingWriter, queue <-chan Resource, integrityCheck bool) ([]ManifestEntry, error) {
+	var entries []ManifestEntry
 
-	zw := zip.NewWriter(zf)
 	for res := range queue {
-		if res.fpath == "" {
+		if res.body == nil {
 			continue
 		}
-		defer os.Remove(res.fpath)
 
-		err := addToZip(zw, res)
+		entry, err := addEntry(a, cw, res, integrityCheck)
 		if err != nil {
-			return "", err
+			return entries, err
 		}
-	}
 
-	err = zw.Close()
-	if err != nil {
-		return "", fmt.Errorf("failed to close zip file: %w", err)
+		entries = append(entries, entry)
 	}
 
-	return zf.Name(), nil
+	return entries, nil
 }
 
-func addToZip(zw *zip.Writer, res Resource) error {
-	w, err := zw.Create(res.FileName)
-	if err != nil {
-		return fmt.Errorf("failed to add a file to the zip file: %w", err)
+func addEntry(a Archiver, cw *countingWriter, res Resource, integrityCheck bool) (ManifestEntry, error) {
+	defer res.body.Close()
+
+	offset := cw.n
+	crc := crc32.NewIEEE()
+
+	body := io.Reader(res.body)
+	var sha hash.Hash
+	if integrityCheck && res.ExpectedSHA256 != "" {
+		sha = sha256.New()
+		body = io.TeeReader(body, sha)
 	}
 
-	resFile, err := os.Open(res.fpath)
-	if err != nil {
-		return fmt.Errorf("failed to open a downloaded file: %w", err)
+	if err := a.AddFile(res.FileName, res.modified, res.size, io.TeeReader(body, crc)); err != nil {
+		return ManifestEntry{}, fmt.Errorf("failed to add a file to the archive: %w", err)
 	}
-	defer resFile.Close()
 
-	_, err = io.Copy(w, resFile)
-	if err != nil {
-		return fmt.Errorf("failed to compress a file: %w", err)
+	if sha != nil {
+		got := hex.EncodeToString(sha.Sum(nil))
+		if got != res.ExpectedSHA256 {
+			return ManifestEntry{}, &IntegrityError{Resource: res, Got: got, Want: res.ExpectedSHA256}
+		}
+	}
+
+	entry := ManifestEntry{
+		FileName: res.FileName,
+		Bucket:   res.Object.Bucket,
+		Key:      res.Object.Key,
+		Size:     res.size,
+		CRC32:    crc.Sum32(),
+		Offset:   offset,
+	}
+
+	// DataOffset/CompressedSize are only knowable ahead of time when a is a
+	// ZipArchiver using zip.Store (see WithManifest), and only ZipArchiver
+	// itself can report them accurately — see its lastOffset field.
+	// checkManifestCompatible is what keeps this from silently producing a
+	// useless manifest for any other archiver.
+	if za, ok := a.(*ZipArchiver); ok && za.method == zip.Store {
+		entry.Offset = za.lastOffset
+		entry.DataOffset = za.lastDataOffset
+		entry.CompressedSize = za.lastCompressedSize
+	}
+
+	return entry, nil
+}
+
+// checkManifestCompatible returns a descriptive error unless z.archiver can
+// produce a manifest whose entries are actually independently
+// range-fetchable: only a ZipArchiver using zip.Store qualifies, since
+// compressed size equals uncompressed size there, letting DataOffset/
+// CompressedSize be computed without decompressing anything.
+func (z S3Zip) checkManifestCompatible() error {
+	za, ok := z.archiver.(*ZipArchiver)
+	if !ok {
+		return fmt.Errorf("manifest requires a ZipArchiver using zip.Store, got %T", z.archiver)
+	}
+	if za.method != zip.Store {
+		return fmt.Errorf("manifest requires a ZipArchiver using zip.Store, got compression method %d", za.method)
 	}
 
 	return nil
 }
 
+// drainResources reads every remaining Resource off queue, closing each
+// one's body (which also removes its backing temp file, see tempFile) without
+// archiving it. Used once archive has already returned an error, to unblock
+// any download worker still waiting to send a finished Resource into a queue
+// nothing is consuming any longer.
+func drainResources(queue <-chan Resource) {
+	for res := range queue {
+		if res.body != nil {
+			res.body.Close()
+		}
+	}
+}
+
+// archiverIsZip reports whether z.archiver produces a zip archive, i.e.
+// whether the 32-bit zip size limits that WithZip64 governs even apply.
+func (z S3Zip) archiverIsZip() bool {
+	switch z.archiver.(type) {
+	case *ZipArchiver, *ZipZstdArchiver:
+		return true
+	default:
+		return false
+	}
+}
+
+// firstError records the first error reported to it by any of several
+// concurrent download workers.
+type firstError struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (e *firstError) set(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+func (e *firstError) get() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.err
+}
+
+// countingWriter tracks how many bytes have been written through it so far,
+// which is how Do knows the archive offset of each entry it writes.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
 func gen(resources ...Resource) <-chan Resource {
 	ch := make(chan Resource)
 
@@ -1,8 +1,17 @@
 package s3zip
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws/session"
 )
@@ -33,6 +42,200 @@ func TestNew(t *testing.T) {
 	})
 }
 
+func TestWithZip64(t *testing.T) {
+	z := New(session.New())
+
+	if !z.zip64 {
+		t.Error("expected zip64 to default to true")
+	}
+
+	WithZip64(false)(&z)
+	if z.zip64 {
+		t.Error("expected WithZip64(false) to disable zip64")
+	}
+}
+
+func TestWithIntegrityCheck(t *testing.T) {
+	z := New(session.New())
+
+	if !z.integrityCheck {
+		t.Error("expected integrity checking to default to true")
+	}
+
+	WithIntegrityCheck(false)(&z)
+	if z.integrityCheck {
+		t.Error("expected WithIntegrityCheck(false) to disable integrity checking")
+	}
+}
+
+func TestWithManifest(t *testing.T) {
+	z := New(session.New())
+
+	if z.manifestKey != "" {
+		t.Errorf("expected no manifest by default, got %q", z.manifestKey)
+	}
+
+	WithManifest("archive.manifest.json")(&z)
+	if z.manifestKey != "archive.manifest.json" {
+		t.Errorf("expected manifest key to be %q, got %q", "archive.manifest.json", z.manifestKey)
+	}
+}
+
+func TestDoRejectsManifestWithNonZipArchiver(t *testing.T) {
+	z := New(session.New(),
+		WithManifest("archive.manifest.json"),
+		WithArchiver(NewTarGzArchiver()),
+	)
+
+	err := z.Do(context.Background(), Object{Bucket: "b", Key: "archive.tar.gz"}, nil)
+	if err == nil {
+		t.Fatal("expected Do to reject a manifest paired with a non-zip archiver")
+	}
+}
+
+func TestWithArchiver(t *testing.T) {
+	z := New(session.New())
+	if _, ok := z.archiver.(*ZipArchiver); !ok {
+		t.Fatalf("expected default archiver to be a *ZipArchiver, got %T", z.archiver)
+	}
+
+	tarArchiver := NewTarArchiver()
+	WithArchiver(tarArchiver)(&z)
+	if z.archiver != tarArchiver {
+		t.Error("expected WithArchiver to replace the archiver")
+	}
+}
+
+// TestDoUploadsArchiveChecksumAndManifest drives Do end-to-end against a fake
+// S3 backend and inspects what it actually produced, rather than just
+// exercising the option setters: the uploaded archive's contents, its
+// checksum tag (tagChecksum) and its manifest (uploadManifest).
+func TestDoUploadsArchiveChecksumAndManifest(t *testing.T) {
+	f := newFakeS3()
+	f.put("src", "a.txt", []byte("hello world"), nil)
+
+	srv := f.server(t)
+	defer srv.Close()
+
+	z := testS3Zip(srv, WithCompression(zip.Store), WithManifest("archive.manifest.json"))
+
+	destObj := Object{Bucket: "dst", Key: "archive.zip"}
+	resources := []Resource{
+		{Object: Object{Bucket: "src", Key: "a.txt"}, FileName: "a.txt"},
+	}
+
+	if err := z.Do(context.Background(), destObj, resources); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+
+	archiveObj, ok := f.get("dst", "archive.zip")
+	if !ok {
+		t.Fatal("expected the archive to be uploaded")
+	}
+
+	checksum, ok := archiveObj.metadata[archiveChecksumMetadataKey]
+	if !ok || checksum == "" {
+		t.Fatal("expected the archive to be tagged with its checksum")
+	}
+	want := sha256.Sum256(archiveObj.body)
+	if checksum != hex.EncodeToString(want[:]) {
+		t.Errorf("expected checksum %x, got %s", want, checksum)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(archiveObj.body), int64(len(archiveObj.body)))
+	if err != nil {
+		t.Fatalf("failed to read back archive: %v", err)
+	}
+	if len(zr.File) != 1 || zr.File[0].Name != "a.txt" {
+		t.Fatalf("unexpected archive contents: %+v", zr.File)
+	}
+
+	manifestObj, ok := f.get("dst", "archive.manifest.json")
+	if !ok {
+		t.Fatal("expected the manifest to be uploaded")
+	}
+
+	var entries []ManifestEntry
+	if err := json.Unmarshal(manifestObj.body, &entries); err != nil {
+		t.Fatalf("failed to unmarshal manifest: %v", err)
+	}
+	if len(entries) != 1 || entries[0].FileName != "a.txt" {
+		t.Fatalf("unexpected manifest: %+v", entries)
+	}
+
+	entry := entries[0]
+	got := archiveObj.body[entry.DataOffset : entry.DataOffset+entry.CompressedSize]
+	if string(got) != "hello world" {
+		t.Errorf("manifest entry's DataOffset/CompressedSize located %q, want %q", got, "hello world")
+	}
+}
+
+// closeTrackingBody is an io.ReadCloser whose Close increments a counter, so
+// tests can assert a Resource's body was actually closed.
+type closeTrackingBody struct {
+	io.Reader
+	closed *int
+}
+
+func (b closeTrackingBody) Close() error {
+	*b.closed++
+	return nil
+}
+
+func TestDrainResourcesClosesRemainingBodies(t *testing.T) {
+	var aClosed, bClosed int
+
+	queue := make(chan Resource, 2)
+	queue <- Resource{body: closeTrackingBody{strings.NewReader(""), &aClosed}}
+	queue <- Resource{body: closeTrackingBody{strings.NewReader(""), &bClosed}}
+	close(queue)
+
+	drainResources(queue)
+
+	if aClosed != 1 || bClosed != 1 {
+		t.Errorf("expected drainResources to close every remaining body, got aClosed=%d bClosed=%d", aClosed, bClosed)
+	}
+}
+
+// TestDrainResourcesUnblocksMergeForwarders reproduces the goroutine/temp-file
+// leak an archive error used to cause: once something stops reading the
+// channel merge() feeds archive() from, merge's own per-worker forwarding
+// goroutines are left blocked sending into it forever. Without
+// drainResources actually draining queue below, this test would hang until
+// it times out.
+func TestDrainResourcesUnblocksMergeForwarders(t *testing.T) {
+	c1 := make(chan Resource)
+	c2 := make(chan Resource)
+
+	go func() {
+		defer close(c1)
+		c1 <- Resource{FileName: "a"}
+		c1 <- Resource{FileName: "b"} // blocks here until queue is drained
+	}()
+	go func() {
+		defer close(c2)
+		c2 <- Resource{FileName: "c"}
+	}()
+
+	queue := merge(c1, c2)
+
+	// Simulate archive() having already consumed one item before bailing out
+	// on an error, same as Do does.
+	<-queue
+
+	done := make(chan struct{})
+	go func() {
+		drainResources(queue)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected drainResources to unblock merge's forwarding goroutines")
+	}
+}
+
 func TestWithConcurrency(t *testing.T) {
 	z := New(session.New())
 
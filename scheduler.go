@@ -0,0 +1,337 @@
+package s3zip
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// sourceDigestMetadataKey is the destination object metadata key Scheduler
+// uses to remember, between runs, a digest of the source listing that
+// produced it. It is only written and read when SchedulerConfig.SkipIfUnchanged
+// is set.
+const sourceDigestMetadataKey = "Source-Digest"
+
+// pointerKeySuffix names the small object Scheduler uses to remember, across
+// process restarts, the destination key of the last archive it produced. It
+// is stored in DestBucket under the source Prefix (see pointerKey), not
+// necessarily next to the archives themselves.
+const pointerKeySuffix = ".s3zip-scheduler-last-key"
+
+// SchedulerConfig configures a Scheduler.
+type SchedulerConfig struct {
+	SourceBucket string
+	Prefix       string
+
+	DestBucket string
+	// KeyTemplate is a time.Format reference layout used to build the
+	// destination key for each run, e.g. "backups/2006-01-02T15:04:05Z.zip".
+	KeyTemplate string
+
+	Interval time.Duration
+
+	// Filter, if set, is called for every object under Prefix; objects for
+	// which it returns false are left out of the archive.
+	Filter func(*s3.Object) bool
+
+	// SkipIfUnchanged compares a digest of the source listing's keys and
+	// ETags against the digest stored on the previous archive this Scheduler
+	// produced, and skips the run if nothing changed.
+	SkipIfUnchanged bool
+}
+
+// RunResult reports the outcome of a single Scheduler run.
+type RunResult struct {
+	Time      time.Time
+	DestKey   string
+	Resources int
+	Skipped   bool
+	Err       error
+}
+
+// Scheduler periodically archives a source bucket+prefix into a rolling
+// destination key.
+type Scheduler struct {
+	z   S3Zip
+	cfg SchedulerConfig
+
+	results chan RunResult
+	stop    chan struct{}
+	done    chan struct{}
+
+	lastKey string
+}
+
+// NewScheduler creates a Scheduler that uses z to archive objects on the
+// schedule described by cfg.
+func NewScheduler(z S3Zip, cfg SchedulerConfig) *Scheduler {
+	return &Scheduler{
+		z:       z,
+		cfg:     cfg,
+		results: make(chan RunResult),
+		stop:    make(chan struct{}),
+	}
+}
+
+// Results returns the channel RunResults are published to. Callers must
+// drain it or Start's goroutine will block after each run.
+func (s *Scheduler) Results() <-chan RunResult {
+	return s.results
+}
+
+// Start runs the scheduler in the background, once immediately and then
+// every cfg.Interval, until ctx is cancelled or Stop is called.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.cfg.Interval)
+		defer ticker.Stop()
+
+		s.runOnce(ctx)
+
+		for {
+			select {
+			case <-ticker.C:
+				s.runOnce(ctx)
+			case <-s.stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the scheduler started by Start and waits for its goroutine to
+// exit.
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+func (s *Scheduler) runOnce(ctx context.Context) {
+	now := time.Now()
+	result := RunResult{Time: now, DestKey: now.UTC().Format(s.cfg.KeyTemplate)}
+
+	resources, digest, err := s.listResources(ctx)
+	if err != nil {
+		result.Err = fmt.Errorf("failed to list source objects: %w", err)
+		s.emit(result)
+		return
+	}
+	result.Resources = len(resources)
+
+	if s.cfg.SkipIfUnchanged {
+		unchanged, err := s.digestUnchanged(ctx, digest)
+		if err != nil {
+			result.Err = fmt.Errorf("failed to check previous archive: %w", err)
+			s.emit(result)
+			return
+		}
+		if unchanged {
+			result.Skipped = true
+			s.emit(result)
+			return
+		}
+	}
+
+	destObj := Object{Bucket: s.cfg.DestBucket, Key: result.DestKey}
+
+	if err := s.z.Do(ctx, destObj, resources); err != nil {
+		result.Err = fmt.Errorf("failed to archive: %w", err)
+		s.emit(result)
+		return
+	}
+
+	if s.cfg.SkipIfUnchanged {
+		if err := s.tagDigest(ctx, destObj, digest); err != nil {
+			result.Err = fmt.Errorf("failed to tag archive with its digest: %w", err)
+			s.emit(result)
+			return
+		}
+
+		if err := s.savePointer(ctx, result.DestKey); err != nil {
+			result.Err = fmt.Errorf("failed to save last-archive pointer: %w", err)
+			s.emit(result)
+			return
+		}
+	}
+
+	s.lastKey = result.DestKey
+
+	s.emit(result)
+}
+
+func (s *Scheduler) emit(r RunResult) {
+	select {
+	case s.results <- r:
+	case <-s.stop:
+	}
+}
+
+// listResources lists every object under cfg.SourceBucket/cfg.Prefix that
+// passes cfg.Filter, and returns them as archive Resources alongside a
+// digest of their keys and ETags.
+func (s *Scheduler) listResources(ctx context.Context) ([]Resource, string, error) {
+	var resources []Resource
+	h := sha256.New()
+
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.cfg.SourceBucket),
+		Prefix: aws.String(s.cfg.Prefix),
+	}
+
+	err := s.z.s3.ListObjectsV2PagesWithContext(ctx, input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			if s.cfg.Filter != nil && !s.cfg.Filter(obj) {
+				continue
+			}
+
+			fmt.Fprintf(h, "%s:%s\n", aws.StringValue(obj.Key), aws.StringValue(obj.ETag))
+
+			resources = append(resources, Resource{
+				Object:   Object{Bucket: s.cfg.SourceBucket, Key: aws.StringValue(obj.Key)},
+				FileName: strings.TrimPrefix(aws.StringValue(obj.Key), s.cfg.Prefix),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return resources, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// digestUnchanged reports whether digest matches the digest stored on the
+// previous archive this Scheduler produced. s.lastKey only lives for the
+// lifetime of this process, so when it's empty (e.g. right after a restart)
+// this falls back to the pointer object saved by savePointer. When neither
+// names a previous archive, or that archive is gone, the digest is never
+// considered unchanged.
+func (s *Scheduler) digestUnchanged(ctx context.Context, digest string) (bool, error) {
+	lastKey := s.lastKey
+	if lastKey == "" {
+		key, err := s.loadPointer(ctx)
+		if err != nil {
+			return false, err
+		}
+		lastKey = key
+	}
+	if lastKey == "" {
+		return false, nil
+	}
+
+	head, err := s.z.s3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.cfg.DestBucket),
+		Key:    aws.String(lastKey),
+	})
+	if err != nil {
+		return false, nil
+	}
+
+	prev, ok := head.Metadata[sourceDigestMetadataKey]
+	if !ok {
+		return false, nil
+	}
+
+	if aws.StringValue(prev) != digest {
+		return false, nil
+	}
+
+	s.lastKey = lastKey
+
+	return true, nil
+}
+
+// pointerKey is where savePointer/loadPointer remember the destination key
+// of the last archive produced under cfg.Prefix, so SkipIfUnchanged survives
+// a process restart.
+func (s *Scheduler) pointerKey() string {
+	return strings.TrimSuffix(s.cfg.Prefix, "/") + "/" + pointerKeySuffix
+}
+
+// loadPointer reads back the destination key saved by the most recent
+// savePointer call, or "" if none has been saved yet (or it was deleted).
+func (s *Scheduler) loadPointer(ctx context.Context) (string, error) {
+	out, err := s.z.s3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.cfg.DestBucket),
+		Key:    aws.String(s.pointerKey()),
+	})
+	if err != nil {
+		if isNotFoundErr(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	defer out.Body.Close()
+
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// savePointer records destKey as the last archive this Scheduler produced,
+// so a future process can resume SkipIfUnchanged comparisons after a
+// restart.
+func (s *Scheduler) savePointer(ctx context.Context, destKey string) error {
+	_, err := s.z.s3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.cfg.DestBucket),
+		Key:    aws.String(s.pointerKey()),
+		Body:   strings.NewReader(destKey),
+	})
+
+	return err
+}
+
+// isNotFoundErr reports whether err is S3's way of saying an object doesn't
+// exist.
+func isNotFoundErr(err error) bool {
+	var reqFailure awserr.RequestFailure
+	if errors.As(err, &reqFailure) {
+		return reqFailure.StatusCode() == 404
+	}
+
+	return false
+}
+
+// tagDigest records digest as metadata on the just-uploaded archive, via a
+// self-copy with a replaced metadata set.
+func (s *Scheduler) tagDigest(ctx context.Context, destObj Object, digest string) error {
+	_, err := s.z.s3.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:            aws.String(destObj.Bucket),
+		Key:               aws.String(destObj.Key),
+		CopySource:        aws.String(copySource(destObj.Bucket, destObj.Key)),
+		Metadata:          map[string]*string{sourceDigestMetadataKey: aws.String(digest)},
+		MetadataDirective: aws.String(s3.MetadataDirectiveReplace),
+	})
+
+	return err
+}
+
+// copySource builds an S3 CopySource value, percent-encoding each path
+// segment of key as required by the CopyObject API.
+func copySource(bucket, key string) string {
+	segments := strings.Split(key, "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+
+	return bucket + "/" + strings.Join(segments, "/")
+}
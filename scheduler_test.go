@@ -0,0 +1,373 @@
+package s3zip
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+func TestCopySource(t *testing.T) {
+	cases := []struct {
+		bucket, key, want string
+	}{
+		{"my-bucket", "backups/2024-01-15.zip", "my-bucket/backups/2024-01-15.zip"},
+		{"my-bucket", "a file with spaces.zip", "my-bucket/a%20file%20with%20spaces.zip"},
+	}
+
+	for _, c := range cases {
+		if got := copySource(c.bucket, c.key); got != c.want {
+			t.Errorf("copySource(%q, %q) = %q, want %q", c.bucket, c.key, got, c.want)
+		}
+	}
+}
+
+func TestNewScheduler(t *testing.T) {
+	z := New(session.New())
+	cfg := SchedulerConfig{
+		SourceBucket: "src",
+		DestBucket:   "dst",
+		KeyTemplate:  "backups/2006-01-02.zip",
+	}
+
+	s := NewScheduler(z, cfg)
+
+	if s.cfg.SourceBucket != cfg.SourceBucket {
+		t.Errorf("expected source bucket to be %q, got %q", cfg.SourceBucket, s.cfg.SourceBucket)
+	}
+
+	if s.results == nil || s.stop == nil {
+		t.Error("expected NewScheduler to initialize its channels")
+	}
+}
+
+// fakeObject is one object held by fakeS3.
+type fakeObject struct {
+	body     []byte
+	etag     string
+	metadata map[string]string
+}
+
+// fakeS3 is a minimal in-memory S3 stand-in, just capable enough to drive
+// Scheduler: ListObjectsV2, GetObject (with Range support), PutObject,
+// CopyObject (self-copy with a replaced metadata set) and HeadObject.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]map[string]*fakeObject
+	nextTag int
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string]map[string]*fakeObject{}}
+}
+
+func (f *fakeS3) put(bucket, key string, body []byte, metadata map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.objects[bucket] == nil {
+		f.objects[bucket] = map[string]*fakeObject{}
+	}
+	f.nextTag++
+	f.objects[bucket][key] = &fakeObject{body: body, etag: fmt.Sprintf("etag%d", f.nextTag), metadata: metadata}
+}
+
+func (f *fakeS3) get(bucket, key string) (*fakeObject, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	obj, ok := f.objects[bucket][key]
+	return obj, ok
+}
+
+func (f *fakeS3) server(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/")
+		parts := strings.SplitN(path, "/", 2)
+		bucket := parts[0]
+		var key string
+		if len(parts) > 1 {
+			key = parts[1]
+		}
+
+		if r.URL.Query().Get("list-type") == "2" {
+			f.handleList(w, bucket, r.URL.Query().Get("prefix"))
+			return
+		}
+
+		switch r.Method {
+		case http.MethodHead:
+			f.handleHead(w, bucket, key)
+		case http.MethodGet:
+			f.handleGet(w, bucket, key, r.Header.Get("Range"))
+		case http.MethodPut:
+			if src := r.Header.Get("X-Amz-Copy-Source"); src != "" {
+				f.handleCopy(w, r, bucket, key)
+			} else {
+				f.handlePut(w, r, bucket, key)
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+}
+
+func (f *fakeS3) handleList(w http.ResponseWriter, bucket, prefix string) {
+	f.mu.Lock()
+	var keys []string
+	for key := range f.objects[bucket] {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var contents strings.Builder
+	for _, key := range keys {
+		obj := f.objects[bucket][key]
+		fmt.Fprintf(&contents, `<Contents><Key>%s</Key><ETag>&quot;%s&quot;</ETag><Size>%d</Size><LastModified>2024-01-01T00:00:00.000Z</LastModified></Contents>`,
+			key, obj.etag, len(obj.body))
+	}
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/xml")
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult><Name>%s</Name><Prefix>%s</Prefix><KeyCount>%d</KeyCount><MaxKeys>1000</MaxKeys><IsTruncated>false</IsTruncated>%s</ListBucketResult>`,
+		bucket, prefix, len(keys), contents.String())
+}
+
+func (f *fakeS3) handleHead(w http.ResponseWriter, bucket, key string) {
+	obj, ok := f.get(bucket, key)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	for k, v := range obj.metadata {
+		w.Header().Set("X-Amz-Meta-"+k, v)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(obj.body)))
+	w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *fakeS3) handleGet(w http.ResponseWriter, bucket, key, rng string) {
+	obj, ok := f.get(bucket, key)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `<Error><Code>NoSuchKey</Code><Message>not found</Message><RequestId>req</RequestId></Error>`)
+		return
+	}
+
+	start, end := int64(0), int64(len(obj.body)-1)
+	if rng != "" {
+		fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+	}
+	if end >= int64(len(obj.body)) {
+		end = int64(len(obj.body)) - 1
+	}
+
+	for k, v := range obj.metadata {
+		w.Header().Set("X-Amz-Meta-"+k, v)
+	}
+	w.WriteHeader(http.StatusOK)
+	if start <= end {
+		w.Write(obj.body[start : end+1])
+	}
+}
+
+func (f *fakeS3) handlePut(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	metadata := map[string]string{}
+	for k := range r.Header {
+		if strings.HasPrefix(strings.ToLower(k), "x-amz-meta-") {
+			metadata[k[len("x-amz-meta-"):]] = r.Header.Get(k)
+		}
+	}
+
+	f.put(bucket, key, body, metadata)
+	w.Header().Set("ETag", `"fake"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *fakeS3) handleCopy(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	obj, ok := f.get(bucket, key)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	metadata := obj.metadata
+	if r.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+		metadata = map[string]string{}
+		for k := range r.Header {
+			if strings.HasPrefix(strings.ToLower(k), "x-amz-meta-") {
+				metadata[k[len("x-amz-meta-"):]] = r.Header.Get(k)
+			}
+		}
+	}
+
+	f.put(bucket, key, obj.body, metadata)
+
+	w.Header().Set("Content-Type", "application/xml")
+	fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><CopyObjectResult><ETag>"fake"</ETag></CopyObjectResult>`)
+}
+
+// testScheduler builds a Scheduler whose S3Zip talks to srv instead of AWS.
+func testScheduler(srv *httptest.Server, cfg SchedulerConfig) *Scheduler {
+	sess := session.Must(session.NewSession(&aws.Config{
+		Endpoint:         aws.String(srv.URL),
+		Region:           aws.String("us-east-1"),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+		S3ForcePathStyle: aws.Bool(true),
+		DisableSSL:       aws.Bool(true),
+		MaxRetries:       aws.Int(0),
+	}))
+
+	return NewScheduler(New(sess), cfg)
+}
+
+func TestListResources(t *testing.T) {
+	f := newFakeS3()
+	f.put("src", "data/a.txt", []byte("a"), nil)
+	f.put("src", "data/b.txt", []byte("bb"), nil)
+	f.put("src", "other/c.txt", []byte("c"), nil)
+
+	srv := f.server(t)
+	defer srv.Close()
+
+	s := testScheduler(srv, SchedulerConfig{SourceBucket: "src", Prefix: "data/"})
+
+	resources, digest1, err := s.listResources(context.Background())
+	if err != nil {
+		t.Fatalf("listResources: %v", err)
+	}
+	if len(resources) != 2 {
+		t.Fatalf("expected 2 resources, got %d", len(resources))
+	}
+	if digest1 == "" {
+		t.Error("expected a non-empty digest")
+	}
+
+	_, digest2, err := s.listResources(context.Background())
+	if err != nil {
+		t.Fatalf("listResources: %v", err)
+	}
+	if digest1 != digest2 {
+		t.Error("expected repeated listing of unchanged objects to produce the same digest")
+	}
+
+	f.put("src", "data/a.txt", []byte("changed"), nil)
+	_, digest3, err := s.listResources(context.Background())
+	if err != nil {
+		t.Fatalf("listResources: %v", err)
+	}
+	if digest3 == digest1 {
+		t.Error("expected a changed object to change the digest")
+	}
+}
+
+func TestDigestUnchangedSurvivesRestart(t *testing.T) {
+	f := newFakeS3()
+	f.put("src", "data/a.txt", []byte("a"), nil)
+
+	srv := f.server(t)
+	defer srv.Close()
+
+	cfg := SchedulerConfig{SourceBucket: "src", Prefix: "data/", DestBucket: "dst", SkipIfUnchanged: true}
+	s := testScheduler(srv, cfg)
+
+	_, digest, err := s.listResources(context.Background())
+	if err != nil {
+		t.Fatalf("listResources: %v", err)
+	}
+
+	// Simulate a previous run having produced and tagged an archive.
+	f.put("dst", "archive.zip", []byte("zip bytes"), map[string]string{sourceDigestMetadataKey: digest})
+	if err := s.savePointer(context.Background(), "archive.zip"); err != nil {
+		t.Fatalf("savePointer: %v", err)
+	}
+
+	// A fresh Scheduler, as after a process restart, starts with no in-memory
+	// lastKey and must fall back to the saved pointer.
+	restarted := testScheduler(srv, cfg)
+	unchanged, err := restarted.digestUnchanged(context.Background(), digest)
+	if err != nil {
+		t.Fatalf("digestUnchanged: %v", err)
+	}
+	if !unchanged {
+		t.Error("expected digestUnchanged to find the persisted pointer across a simulated restart")
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	f := newFakeS3()
+	f.put("src", "data/a.txt", []byte("hello"), nil)
+
+	srv := f.server(t)
+	defer srv.Close()
+
+	cfg := SchedulerConfig{
+		SourceBucket:    "src",
+		Prefix:          "data/",
+		DestBucket:      "dst",
+		KeyTemplate:     "archive.zip",
+		SkipIfUnchanged: true,
+	}
+	s := testScheduler(srv, cfg)
+
+	go s.runOnce(context.Background())
+	result := <-s.results
+	if result.Err != nil {
+		t.Fatalf("unexpected error: %v", result.Err)
+	}
+	if result.Skipped {
+		t.Fatal("expected the first run not to be skipped")
+	}
+	if result.Resources != 1 {
+		t.Errorf("expected 1 resource archived, got %d", result.Resources)
+	}
+
+	if _, ok := f.get("dst", "archive.zip"); !ok {
+		t.Fatal("expected an archive to be uploaded")
+	}
+
+	// Nothing changed under the source prefix, so a second run should skip.
+	go s.runOnce(context.Background())
+	result = <-s.results
+	if result.Err != nil {
+		t.Fatalf("unexpected error: %v", result.Err)
+	}
+	if !result.Skipped {
+		t.Error("expected the second run to be skipped since nothing changed")
+	}
+
+	// A fresh Scheduler (simulating a restart) should still skip, via the
+	// persisted pointer rather than in-memory state.
+	restarted := testScheduler(srv, cfg)
+	go restarted.runOnce(context.Background())
+	result = <-restarted.results
+	if result.Err != nil {
+		t.Fatalf("unexpected error: %v", result.Err)
+	}
+	if !result.Skipped {
+		t.Error("expected a restarted Scheduler to still skip thanks to the persisted pointer")
+	}
+}
@@ -0,0 +1,71 @@
+package s3zip
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"time"
+)
+
+// TarArchiver writes an uncompressed tar archive.
+type TarArchiver struct {
+	tw *tar.Writer
+}
+
+// NewTarArchiver creates a TarArchiver.
+func NewTarArchiver() *TarArchiver {
+	return &TarArchiver{}
+}
+
+func (a *TarArchiver) Begin(w io.Writer) error {
+	a.tw = tar.NewWriter(w)
+	return nil
+}
+
+func (a *TarArchiver) AddFile(name string, modTime time.Time, size int64, r io.Reader) error {
+	err := a.tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Size:    size,
+		Mode:    0644,
+		ModTime: modTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(a.tw, r)
+
+	return err
+}
+
+func (a *TarArchiver) Close() error {
+	return a.tw.Close()
+}
+
+// TarGzArchiver writes a gzip-compressed tar archive.
+type TarGzArchiver struct {
+	tar *TarArchiver
+	gw  *gzip.Writer
+}
+
+// NewTarGzArchiver creates a TarGzArchiver.
+func NewTarGzArchiver() *TarGzArchiver {
+	return &TarGzArchiver{tar: NewTarArchiver()}
+}
+
+func (a *TarGzArchiver) Begin(w io.Writer) error {
+	a.gw = gzip.NewWriter(w)
+	return a.tar.Begin(a.gw)
+}
+
+func (a *TarGzArchiver) AddFile(name string, modTime time.Time, size int64, r io.Reader) error {
+	return a.tar.AddFile(name, modTime, size, r)
+}
+
+func (a *TarGzArchiver) Close() error {
+	if err := a.tar.Close(); err != nil {
+		return err
+	}
+
+	return a.gw.Close()
+}
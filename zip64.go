@@ -0,0 +1,49 @@
+package s3zip
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// maxZip32Size is the largest file or archive size representable without
+// Zip64 extensions (the zip format's 32-bit size and offset fields).
+const maxZip32Size = math.MaxUint32
+
+// sizeGuard rejects downloads that would make the archive exceed the 32-bit
+// zip limits, for callers that disabled Zip64 support via WithZip64(false).
+// A zero limit means no check is performed, since archive/zip already upgrades
+// an entry to Zip64 automatically once it needs it.
+type sizeGuard struct {
+	mu    sync.Mutex
+	total int64
+	limit int64
+}
+
+// newSizeGuard returns a sizeGuard that enforces maxZip32Size when zip64 is
+// false, and otherwise never rejects anything.
+func newSizeGuard(zip64 bool) *sizeGuard {
+	if zip64 {
+		return &sizeGuard{limit: 0}
+	}
+
+	return &sizeGuard{limit: maxZip32Size}
+}
+
+// add accounts for size more bytes being added to the archive, and returns
+// an error if that would push the running total past the guard's limit.
+func (g *sizeGuard) add(size int64) error {
+	if g.limit <= 0 {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.total += size
+	if g.total > g.limit {
+		return fmt.Errorf("archive would grow to %d bytes, exceeding the %d byte limit without zip64 support", g.total, g.limit)
+	}
+
+	return nil
+}
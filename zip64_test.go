@@ -0,0 +1,78 @@
+package s3zip
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// zip64ExtraID is the Zip64 extended information extra field tag, as defined
+// by the zip APPNOTE; archive/zip doesn't expose whether a given entry used
+// it, so tests that need to know inspect FileHeader.Extra directly.
+const zip64ExtraID = 0x0001
+
+func hasZip64Extra(extra []byte) bool {
+	for len(extra) >= 4 {
+		tag := uint16(extra[0]) | uint16(extra[1])<<8
+		size := int(uint16(extra[2]) | uint16(extra[3])<<8)
+		if tag == zip64ExtraID {
+			return true
+		}
+		extra = extra[4+size:]
+	}
+
+	return false
+}
+
+// TestZip64NotForcedOnSmallEntries codifies a known limitation documented on
+// WithZip64: archive/zip decides whether an entry gets Zip64 extensions
+// purely from its actual size, and that decision can't be overridden through
+// its public API, so a small entry never gets Zip64 headers no matter what
+// this package is configured to do.
+func TestZip64NotForcedOnSmallEntries(t *testing.T) {
+	var buf bytes.Buffer
+
+	a := NewZipArchiver(zip.Store)
+	if err := a.Begin(&buf); err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if err := a.AddFile("hello.txt", time.Now(), 5, strings.NewReader("hello")); err != nil {
+		t.Fatalf("AddFile: %v", err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("failed to read back zip: %v", err)
+	}
+
+	if hasZip64Extra(zr.File[0].Extra) {
+		t.Error("expected a small entry to never carry Zip64 extensions")
+	}
+}
+
+func TestSizeGuard(t *testing.T) {
+	t.Run("zip64 enabled never rejects", func(t *testing.T) {
+		g := newSizeGuard(true)
+
+		if err := g.add(maxZip32Size + 1); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("zip64 disabled rejects once the limit is exceeded", func(t *testing.T) {
+		g := newSizeGuard(false)
+
+		if err := g.add(maxZip32Size); err != nil {
+			t.Errorf("expected no error at the limit, got %v", err)
+		}
+
+		if err := g.add(1); err == nil {
+			t.Error("expected an error once the limit is exceeded")
+		}
+	})
+}